@@ -0,0 +1,234 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"image"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/GLobyNew/compressEpubImages/opf"
+)
+
+// targetMaxDimension is the longest-edge pixel size Analyze's recommended
+// ResizePercent aims for, sized for a typical 6" e-reader screen.
+const targetMaxDimension = 1600
+
+// ImageAnalysis is the dry-run projection for a single manifest image.
+type ImageAnalysis struct {
+	Path          string `json:"path"`
+	OriginalSize  int64  `json:"original_size"`
+	ProjectedSize int64  `json:"projected_size"`
+}
+
+// AnalysisReport summarizes what ProcessFile would do to an EPUB without
+// writing any output, so callers can tune Config before committing to a
+// long batch run.
+type AnalysisReport struct {
+	Path                     string          `json:"path"`
+	Images                   []ImageAnalysis `json:"images"`
+	OriginalEPUBSize         int64           `json:"original_epub_size"`
+	ProjectedEPUBSize        int64           `json:"projected_epub_size"`
+	RecommendedResizePercent int             `json:"recommended_resize_percent"`
+	RecommendedQuality       int             `json:"recommended_quality"`
+}
+
+// Analyze runs the resize+encode pipeline against epubPath's manifest
+// images without writing any output, reporting each image's original and
+// projected size alongside a recommended ResizePercent/Quality.
+func (p *EPUBProcessor) Analyze(epubPath string) (*AnalysisReport, error) {
+	zr, err := zip.OpenReader(epubPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open EPUB: %w", err)
+	}
+	defer zr.Close()
+
+	entryByName := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		entryByName[f.Name] = f
+	}
+
+	containerEntry, ok := entryByName["META-INF/container.xml"]
+	if !ok {
+		return nil, fmt.Errorf("EPUB is missing META-INF/container.xml")
+	}
+	containerData, err := readZipEntry(containerEntry)
+	if err != nil {
+		return nil, fmt.Errorf("read container.xml: %w", err)
+	}
+	opfName, err := opf.ParseContainer(containerData)
+	if err != nil {
+		return nil, err
+	}
+	opfEntry, ok := entryByName[opfName]
+	if !ok {
+		return nil, fmt.Errorf("OPF document %s referenced by container.xml not found", opfName)
+	}
+	opfData, err := readZipEntry(opfEntry)
+	if err != nil {
+		return nil, fmt.Errorf("read OPF document %s: %w", opfName, err)
+	}
+	items, err := opf.ParseManifest(opfData)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", opfName, err)
+	}
+
+	opfDir := path.Dir(opfName)
+
+	type job struct {
+		zipName string
+		entry   *zip.File
+		index   int
+	}
+	var jobs []job
+	for i := range items {
+		zipName := path.Join(opfDir, items[i].Href)
+		entry, ok := entryByName[zipName]
+		if !ok {
+			return nil, fmt.Errorf("manifest item %s (href %q) not found in archive", items[i].ID, items[i].Href)
+		}
+		jobs = append(jobs, job{zipName: zipName, entry: entry, index: len(jobs)})
+	}
+
+	images := make([]ImageAnalysis, len(jobs))
+	succeeded := make([]bool, len(jobs))
+	maxDim := 0
+	var compressedImagesSize, projectedImagesSize int64
+	var mu sync.Mutex
+	jobCh := make(chan job)
+
+	var wg sync.WaitGroup
+	for w := 0; w < p.workerConcurrency(len(jobs)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobCh {
+				p.reporter.ImageStart(j.zipName, j.index+1, len(jobs))
+				analysis, dim, err := p.analyzeImage(j.entry)
+				p.reporter.ImageDone(j.zipName, j.index+1, len(jobs), err)
+				if err != nil {
+					continue
+				}
+				analysis.Path = j.zipName
+
+				mu.Lock()
+				images[j.index] = analysis
+				succeeded[j.index] = true
+				compressedImagesSize += int64(j.entry.CompressedSize64)
+				projectedImagesSize += analysis.ProjectedSize
+				if dim > maxDim {
+					maxDim = dim
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, j := range jobs {
+		jobCh <- j
+	}
+	close(jobCh)
+	wg.Wait()
+
+	report := &AnalysisReport{Path: epubPath}
+	for i, img := range images {
+		if succeeded[i] {
+			report.Images = append(report.Images, img)
+		}
+	}
+
+	if info, err := os.Stat(epubPath); err == nil {
+		report.OriginalEPUBSize = info.Size()
+		report.ProjectedEPUBSize = info.Size() - compressedImagesSize + projectedImagesSize
+	}
+	report.RecommendedResizePercent, report.RecommendedQuality = recommendSettings(maxDim)
+
+	return report, nil
+}
+
+// analyzeImage decodes and re-encodes one manifest image entry, discarding
+// the result, to measure its projected output size and original dimensions
+// without writing anything to disk.
+func (p *EPUBProcessor) analyzeImage(entry *zip.File) (ImageAnalysis, int, error) {
+	rc, err := entry.Open()
+	if err != nil {
+		return ImageAnalysis{}, 0, err
+	}
+	defer rc.Close()
+
+	img, format, err := image.Decode(rc)
+	if err != nil {
+		return ImageAnalysis{}, 0, fmt.Errorf("decode image: %w", err)
+	}
+	data, _, err := p.resizeAndEncode(img, format)
+	if err != nil {
+		return ImageAnalysis{}, 0, err
+	}
+
+	bounds := img.Bounds()
+	maxDim := bounds.Dx()
+	if bounds.Dy() > maxDim {
+		maxDim = bounds.Dy()
+	}
+
+	return ImageAnalysis{
+		OriginalSize:  int64(entry.UncompressedSize64),
+		ProjectedSize: int64(len(data)),
+	}, maxDim, nil
+}
+
+// recommendSettings picks a ResizePercent that would bring maxDim down to
+// targetMaxDimension, and a Quality to pair with it, based on the largest
+// image dimension found across the manifest.
+func recommendSettings(maxDim int) (resizePercent, quality int) {
+	if maxDim <= 0 || maxDim <= targetMaxDimension {
+		return 100, 90
+	}
+	percent := targetMaxDimension * 100 / maxDim
+	if percent < 1 {
+		percent = 1
+	}
+	return percent, 80
+}
+
+// runAnalysis drives dry-run mode for main: it resolves input to one or more
+// EPUB files (expanding it as a glob pattern if it contains "*"), analyzes
+// each, and hands the report to p.reporter. When asJSON is set, p.reporter
+// is forced to a JSON reporter regardless of what -reporter selected, so the
+// per-image progress events and the report itself are all well-formed JSON
+// Lines rather than interleaving with human-readable text.
+func runAnalysis(p *EPUBProcessor, input string, asJSON bool) error {
+	if asJSON {
+		p.reporter = NewJSONReporter(os.Stdout)
+	}
+
+	files := []string{input}
+	if strings.Contains(input, "*") {
+		var err error
+		files, err = globFiles(input)
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			return fmt.Errorf("no files found matching pattern: %s", input)
+		}
+	}
+
+	for _, file := range files {
+		if ext := strings.ToLower(filepath.Ext(file)); ext != ".epub" {
+			fmt.Fprintf(os.Stderr, "Error analyzing %s: dry-run analysis only supports .epub files, not %q\n", file, ext)
+			continue
+		}
+
+		report, err := p.Analyze(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error analyzing %s: %v\n", file, err)
+			continue
+		}
+		p.reporter.Report(report)
+	}
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecommendSettings(t *testing.T) {
+	cases := []struct {
+		maxDim      int
+		wantPercent int
+		wantQuality int
+	}{
+		{0, 100, 90},
+		{targetMaxDimension, 100, 90},
+		{targetMaxDimension - 1, 100, 90},
+		{targetMaxDimension * 2, 50, 80},
+		{targetMaxDimension * 100, 1, 80},
+	}
+	for _, c := range cases {
+		percent, quality := recommendSettings(c.maxDim)
+		if percent != c.wantPercent || quality != c.wantQuality {
+			t.Errorf("recommendSettings(%d) = (%d, %d), want (%d, %d)", c.maxDim, percent, quality, c.wantPercent, c.wantQuality)
+		}
+	}
+}
+
+// buildAnalyzeTestEPUB writes a minimal single-image EPUB to dir, with the
+// image sized dim x dim, so Analyze's recommended-settings math can be
+// exercised against a known source dimension.
+func buildAnalyzeTestEPUB(t *testing.T, dir string, dim int) string {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, dim, dim))
+	for y := 0; y < dim; y++ {
+		for x := 0; x < dim; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"mimetype":               "application/epub+zip",
+		"META-INF/container.xml": roundtripContainer,
+		"OEBPS/content.opf": `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" unique-identifier="bookid">
+  <metadata></metadata>
+  <manifest>
+    <item id="img-1" href="images/page.jpg" media-type="image/jpeg"/>
+  </manifest>
+</package>`,
+	}
+
+	epubPath := filepath.Join(dir, "analyze.epub")
+	out, err := os.Create(epubPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+
+	zw := zip.NewWriter(out)
+	for name, content := range files {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "OEBPS/images/page.jpg", Method: zip.Deflate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return epubPath
+}
+
+func TestAnalyze(t *testing.T) {
+	dir := t.TempDir()
+	epubPath := buildAnalyzeTestEPUB(t, dir, 3200)
+
+	p := NewEPUBProcessor()
+	p.config = Config{ResizePercent: 100, Quality: 90}
+	p.reporter = NewSilentReporter()
+
+	report, err := p.Analyze(epubPath)
+	if err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+
+	if report.Path != epubPath {
+		t.Errorf("report.Path = %q, want %q", report.Path, epubPath)
+	}
+	if len(report.Images) != 1 {
+		t.Fatalf("got %d images, want 1: %+v", len(report.Images), report.Images)
+	}
+	if report.Images[0].Path != "OEBPS/images/page.jpg" {
+		t.Errorf("image path = %q, want OEBPS/images/page.jpg", report.Images[0].Path)
+	}
+	if report.Images[0].OriginalSize == 0 || report.Images[0].ProjectedSize == 0 {
+		t.Errorf("expected non-zero sizes, got %+v", report.Images[0])
+	}
+	if info, err := os.Stat(epubPath); err == nil && report.OriginalEPUBSize != info.Size() {
+		t.Errorf("report.OriginalEPUBSize = %d, want %d", report.OriginalEPUBSize, info.Size())
+	}
+
+	wantPercent, wantQuality := recommendSettings(3200)
+	if report.RecommendedResizePercent != wantPercent || report.RecommendedQuality != wantQuality {
+		t.Errorf("recommended = (%d, %d), want (%d, %d)", report.RecommendedResizePercent, report.RecommendedQuality, wantPercent, wantQuality)
+	}
+}
+
+// TestRunAnalysisJSON checks that asJSON forces p.reporter to a JSON
+// reporter regardless of what it was set to before the call, so dry-run
+// output stays well-formed JSON Lines even under -reporter text.
+func TestRunAnalysisJSON(t *testing.T) {
+	dir := t.TempDir()
+	epubPath := buildAnalyzeTestEPUB(t, dir, 800)
+
+	p := NewEPUBProcessor()
+	p.config = Config{ResizePercent: 100, Quality: 90}
+	p.reporter = NewSilentReporter()
+
+	stdout, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	origStdout := os.Stdout
+	os.Stdout = w
+	runErr := runAnalysis(p, epubPath, true)
+	w.Close()
+	os.Stdout = origStdout
+	stdout.Close()
+
+	if runErr != nil {
+		t.Fatalf("runAnalysis: %v", runErr)
+	}
+	if _, ok := p.reporter.(*jsonReporter); !ok {
+		t.Errorf("runAnalysis with asJSON=true left reporter as %T, want *jsonReporter", p.reporter)
+	}
+}
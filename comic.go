@@ -0,0 +1,237 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// imageExts lists the file extensions treated as comic pages. Anything
+// else in a CBZ/CBR archive (ComicInfo.xml, thumbnails) is left untouched.
+var imageExts = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".gif":  true,
+	".bmp":  true,
+	".webp": true,
+	".avif": true,
+}
+
+// comicPage is the re-encoded replacement for one CBZ zip entry.
+type comicPage struct {
+	newName string
+	data    []byte
+}
+
+type comicJob struct {
+	entry *zip.File
+	index int
+}
+
+// processComicZip re-encodes every image page in a CBZ archive, streaming
+// through zip.Reader/zip.Writer just like processEPUBStream, but without
+// any manifest or cross-file references to keep in sync.
+func (p *EPUBProcessor) processComicZip(inputPath, outputPath string) error {
+	zr, err := zip.OpenReader(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer zr.Close()
+
+	var jobs []comicJob
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || !imageExts[strings.ToLower(filepath.Ext(f.Name))] {
+			continue
+		}
+		jobs = append(jobs, comicJob{entry: f, index: len(jobs)})
+	}
+
+	p.stats.TotalImages += len(jobs)
+	if len(jobs) == 0 {
+		p.reporter.Status("No image pages found to process")
+	} else {
+		p.reporter.Status(fmt.Sprintf("Found %d image(s) to process", len(jobs)))
+	}
+
+	pages := make(map[string]*comicPage, len(jobs)) // original entry name -> replacement
+	var pagesMu sync.Mutex
+	jobCh := make(chan comicJob)
+
+	var wg sync.WaitGroup
+	for w := 0; w < p.workerConcurrency(len(jobs)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobCh {
+				p.reporter.ImageStart(j.entry.Name, j.index+1, len(jobs))
+				page, err := p.processComicPage(j.entry)
+				p.recordResult(err == nil)
+				p.reporter.ImageDone(j.entry.Name, j.index+1, len(jobs), err)
+				if err == nil {
+					pagesMu.Lock()
+					pages[j.entry.Name] = page
+					pagesMu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, j := range jobs {
+		jobCh <- j
+	}
+	close(jobCh)
+	wg.Wait()
+
+	return p.writeComicZip(zr, outputPath, pages)
+}
+
+// processComicPage decodes, resizes and re-encodes a single page entry. If
+// the encoder changed its extension, the entry is renamed accordingly;
+// unlike EPUB there are no external references to a page's filename, so no
+// manifest or text rewriting is needed.
+func (p *EPUBProcessor) processComicPage(entry *zip.File) (*comicPage, error) {
+	rc, err := entry.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	p.recordSize(int64(entry.UncompressedSize64), 0)
+
+	data, enc, err := p.processImageStream(rc)
+	if err != nil {
+		return nil, err
+	}
+	p.recordSize(0, int64(len(data)))
+
+	newName := entry.Name
+	if newExt := extForEncoder(enc); newExt != "" && !strings.EqualFold(filepath.Ext(entry.Name), newExt) {
+		newName = strings.TrimSuffix(entry.Name, filepath.Ext(entry.Name)) + newExt
+	}
+
+	return &comicPage{newName: newName, data: data}, nil
+}
+
+// writeComicZip assembles the output CBZ: every source entry in its
+// original order, substituting re-encoded pages and streaming everything
+// else through unchanged.
+func (p *EPUBProcessor) writeComicZip(zr *zip.ReadCloser, outputPath string, pages map[string]*comicPage) error {
+	outFile, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer outFile.Close()
+
+	zw := zip.NewWriter(outFile)
+	defer zw.Close()
+
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if page, ok := pages[f.Name]; ok {
+			if err := writeZipData(zw, page.newName, page.data); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := copyZipEntry(zw, f); err != nil {
+			return fmt.Errorf("failed to copy %s: %w", f.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// checkUnrar verifies the `unrar` CLI is installed, since rar is a
+// proprietary format with no Go extractor in this pipeline.
+func checkUnrar() error {
+	if _, err := exec.LookPath("unrar"); err != nil {
+		return fmt.Errorf("unrar not found. Please install it:\n" +
+			"  macOS: brew install unrar\n" +
+			"  Ubuntu/Debian: sudo apt-get install unrar\n" +
+			"  Windows: Download from https://www.rarlab.com/rar_add.htm")
+	}
+	return nil
+}
+
+// processComicRAR extracts a CBR archive to a temporary directory with
+// `unrar` (read-only; rar has no Go writer), re-encodes its pages in
+// place, and zips the result into outputPath as a CBZ.
+func (p *EPUBProcessor) processComicRAR(inputPath, outputPath string) error {
+	if err := checkUnrar(); err != nil {
+		return err
+	}
+
+	tempDir := fmt.Sprintf("cbr_temp_%d", time.Now().Unix())
+	if err := os.MkdirAll(tempDir, 0755); err != nil {
+		return fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cmd := exec.Command("unrar", "x", "-y", "-inul", inputPath, tempDir+string(os.PathSeparator))
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to extract CBR: %w", err)
+	}
+
+	return p.processComicDir(tempDir, outputPath)
+}
+
+// processComicDir re-encodes every image file under dir in place, then
+// zips the directory into outputPath.
+func (p *EPUBProcessor) processComicDir(dir, outputPath string) error {
+	var paths []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !imageExts[strings.ToLower(filepath.Ext(path))] {
+			return nil
+		}
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list CBR contents: %w", err)
+	}
+
+	p.stats.TotalImages += len(paths)
+	if len(paths) == 0 {
+		p.reporter.Status("No image pages found to process")
+	} else {
+		p.reporter.Status(fmt.Sprintf("Found %d image(s) to process", len(paths)))
+	}
+
+	type comicFileJob struct {
+		path  string
+		index int
+	}
+	jobCh := make(chan comicFileJob)
+
+	var wg sync.WaitGroup
+	for w := 0; w < p.workerConcurrency(len(paths)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobCh {
+				relPath, _ := filepath.Rel(dir, j.path)
+				p.reporter.ImageStart(relPath, j.index+1, len(paths))
+				_, err := p.processImageGo(j.path)
+				p.recordResult(err == nil)
+				p.reporter.ImageDone(relPath, j.index+1, len(paths), err)
+			}
+		}()
+	}
+	for i, path := range paths {
+		jobCh <- comicFileJob{path: path, index: i}
+	}
+	close(jobCh)
+	wg.Wait()
+
+	return p.zipDirectory(dir, outputPath)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"image"
+	_ "image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// buildTestCBZ writes a CBZ with two jpeg pages plus a non-image file
+// (ComicInfo.xml), the latter exercising that unrelated entries pass
+// through writeComicZip unchanged.
+func buildTestCBZ(t *testing.T, dir string) string {
+	t.Helper()
+
+	jpegData := encodeTestJPEG(t)
+
+	cbzPath := filepath.Join(dir, "book.cbz")
+	out, err := os.Create(cbzPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+
+	zw := zip.NewWriter(out)
+	for _, name := range []string{"001.jpg", "002.jpg"} {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(jpegData); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "ComicInfo.xml", Method: zip.Deflate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte(`<ComicInfo><Pages>2</Pages></ComicInfo>`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return cbzPath
+}
+
+// TestProcessComicZipRoundTrip re-encodes a CBZ's pages, forcing a format
+// change (jpeg -> png), and checks the output CBZ has every page renamed
+// with its new extension, every page still a valid image, and the
+// non-image ComicInfo.xml entry copied through unchanged.
+func TestProcessComicZipRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	cbzPath := buildTestCBZ(t, dir)
+	outPath := filepath.Join(dir, "out.cbz")
+
+	p := NewEPUBProcessor()
+	p.config = Config{ResizePercent: 100, Quality: 90, Encoder: EncoderPNG}
+	p.reporter = NewSilentReporter()
+
+	if err := p.processComicZip(cbzPath, outPath); err != nil {
+		t.Fatalf("processComicZip: %v", err)
+	}
+
+	zr, err := zip.OpenReader(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+
+	entries := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		entries[f.Name] = f
+	}
+
+	for _, want := range []string{"001.png", "002.png"} {
+		f, ok := entries[want]
+		if !ok {
+			t.Errorf("output CBZ missing renamed page %q; entries: %v", want, entryNames(zr.File))
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := image.Decode(bytes.NewReader(data)); err != nil {
+			t.Errorf("%s is not a valid image: %v", want, err)
+		}
+	}
+	if _, ok := entries["001.jpg"]; ok {
+		t.Error("original 001.jpg should have been replaced by 001.png, not kept alongside it")
+	}
+
+	info, ok := entries["ComicInfo.xml"]
+	if !ok {
+		t.Fatal("ComicInfo.xml was not copied through to the output CBZ")
+	}
+	rc, err := info.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `<ComicInfo><Pages>2</Pages></ComicInfo>` {
+		t.Errorf("ComicInfo.xml contents changed: %s", data)
+	}
+}
+
+func entryNames(files []*zip.File) []string {
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = f.Name
+	}
+	return names
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Container abstracts one archive format so the shared resize/recompress
+// pipeline can run against EPUB, CBZ and CBR input unmodified.
+type Container interface {
+	// Process re-encodes every image inputPath contains and writes the
+	// result to outputPath.
+	Process(p *EPUBProcessor, inputPath, outputPath string) error
+	// OutputExt returns the extension (including the dot) the output file
+	// should use. It's usually inputExt unchanged, but CBR is read-only
+	// (rar has no Go writer) so it always produces a CBZ.
+	OutputExt(inputExt string) string
+}
+
+// containerForPath returns the Container responsible for path's extension.
+func containerForPath(path string) (Container, error) {
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".epub":
+		return epubContainer{}, nil
+	case ".cbz":
+		return cbzContainer{}, nil
+	case ".cbr":
+		return cbrContainer{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported file type %q (expected .epub, .cbz or .cbr)", ext)
+	}
+}
+
+// epubContainer processes EPUB files via the manifest-driven pipeline
+// (processEPUBStream, or processEPUBViaTempDir for the ImageMagick
+// fallback).
+type epubContainer struct{}
+
+func (epubContainer) OutputExt(inputExt string) string { return inputExt }
+
+func (epubContainer) Process(p *EPUBProcessor, inputPath, outputPath string) error {
+	if p.config.UseImageMagick {
+		if err := p.checkImageMagick(); err != nil {
+			return err
+		}
+		return p.processEPUBViaTempDir(inputPath, outputPath)
+	}
+	return p.processEPUBStream(inputPath, outputPath)
+}
+
+// cbzContainer processes CBZ comic archives: a plain zip of image pages
+// with no manifest to keep in sync.
+type cbzContainer struct{}
+
+func (cbzContainer) OutputExt(inputExt string) string { return inputExt }
+
+func (cbzContainer) Process(p *EPUBProcessor, inputPath, outputPath string) error {
+	return p.processComicZip(inputPath, outputPath)
+}
+
+// cbrContainer processes CBR comic archives by shelling out to `unrar` for
+// extraction (rar is a proprietary format with no Go writer, and unrar
+// itself is read-only), then re-zips the re-encoded pages as a CBZ.
+type cbrContainer struct{}
+
+func (cbrContainer) OutputExt(string) string { return ".cbz" }
+
+func (cbrContainer) Process(p *EPUBProcessor, inputPath, outputPath string) error {
+	return p.processComicRAR(inputPath, outputPath)
+}
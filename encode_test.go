@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResizeImage(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 100, 50))
+
+	cases := []struct {
+		name    string
+		percent int
+		wantW   int
+		wantH   int
+	}{
+		{"100 percent returns original size", 100, 100, 50},
+		{"0 percent (unset) returns original size", 0, 100, 50},
+		{"50 percent halves both dimensions", 50, 50, 25},
+		{"1 percent floors to at least 1px", 1, 1, 1},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			out := resizeImage(src, c.percent)
+			bounds := out.Bounds()
+			if bounds.Dx() != c.wantW || bounds.Dy() != c.wantH {
+				t.Errorf("resizeImage(..., %d) = %dx%d, want %dx%d", c.percent, bounds.Dx(), bounds.Dy(), c.wantW, c.wantH)
+			}
+		})
+	}
+}
+
+func TestResizeImageReturnsSameImageAt100Percent(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	out := resizeImage(src, 100)
+	if out != image.Image(src) {
+		t.Error("resizeImage(..., 100) should return the source image unchanged, not a copy")
+	}
+}
+
+func TestEncoderForSourceFormat(t *testing.T) {
+	cases := map[string]Encoder{
+		"jpeg": EncoderJPEG,
+		"JPEG": EncoderJPEG,
+		"webp": EncoderWebP,
+		"avif": EncoderAVIF,
+		"png":  EncoderPNG,
+		"gif":  EncoderPNG,
+		"bmp":  EncoderPNG,
+	}
+	for format, want := range cases {
+		if got := encoderForSourceFormat(format); got != want {
+			t.Errorf("encoderForSourceFormat(%q) = %q, want %q", format, got, want)
+		}
+	}
+}
+
+func TestExtForEncoder(t *testing.T) {
+	cases := map[Encoder]string{
+		EncoderJPEG: ".jpg",
+		EncoderPNG:  ".png",
+		EncoderWebP: ".webp",
+		EncoderAVIF: ".avif",
+		EncoderAuto: "",
+	}
+	for enc, want := range cases {
+		if got := extForEncoder(enc); got != want {
+			t.Errorf("extForEncoder(%q) = %q, want %q", enc, got, want)
+		}
+	}
+}
+
+func TestEncodeImageUnknownEncoder(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	if err := encodeImage(&bytes.Buffer{}, img, Encoder("bogus"), 90); err == nil {
+		t.Error("encodeImage with an unknown encoder should return an error, got nil")
+	}
+}
+
+func TestDecodeImage(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.png")
+
+	src := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	src.Set(0, 0, color.RGBA{R: 255, A: 255})
+
+	var buf bytes.Buffer
+	if err := encodeImage(&buf, src, EncoderPNG, 90); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	img, format, err := decodeImage(path)
+	if err != nil {
+		t.Fatalf("decodeImage: %v", err)
+	}
+	if format != "png" {
+		t.Errorf("format = %q, want png", format)
+	}
+	bounds := img.Bounds()
+	if bounds.Dx() != 4 || bounds.Dy() != 4 {
+		t.Errorf("decoded dimensions = %dx%d, want 4x4", bounds.Dx(), bounds.Dy())
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/GLobyNew/compressEpubImages/opf"
+)
+
+// mediaTypeForExt maps a file extension to the OPF media-type it declares,
+// for the image formats this processor can produce.
+func mediaTypeForExt(ext string) string {
+	switch strings.ToLower(ext) {
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	case ".png":
+		return "image/png"
+	case ".webp":
+		return "image/webp"
+	case ".avif":
+		return "image/avif"
+	default:
+		return ""
+	}
+}
+
+// processManifestImages processes exactly the image items declared in the
+// EPUB's OPF manifest, rather than every file under extractDir that happens
+// to look like an image. When the encoder changes an item's extension, the
+// manifest and every XHTML/CSS reference to it are rewritten to match.
+func (p *EPUBProcessor) processManifestImages(extractDir string) error {
+	manifest, err := opf.Parse(extractDir)
+	if err != nil {
+		return fmt.Errorf("failed to parse OPF manifest: %w", err)
+	}
+
+	items := manifest.Items
+	p.stats.TotalImages += len(items)
+
+	if len(items) == 0 {
+		p.reporter.Status("No manifest image items found to process")
+		return nil
+	}
+
+	p.reporter.Status(fmt.Sprintf("Found %d image(s) to process", len(items)))
+
+	type job struct {
+		item  *opf.Item
+		index int
+	}
+	jobs := make(chan job)
+
+	// manifestMu serializes the OPF/XHTML/CSS rewrites RenameItem performs,
+	// since those touch shared files on disk rather than per-image state.
+	var manifestMu sync.Mutex
+
+	var wg sync.WaitGroup
+	for w := 0; w < p.workerConcurrency(len(items)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				itemPath, pathErr := manifest.Path(*j.item)
+				relPath := j.item.Href
+				if pathErr == nil {
+					if rel, err := filepath.Rel(extractDir, itemPath); err == nil {
+						relPath = rel
+					}
+				}
+				p.reporter.ImageStart(relPath, j.index+1, len(items))
+
+				err := pathErr
+				if err == nil {
+					err = p.processManifestImage(manifest, j.item, &manifestMu)
+				}
+				p.recordResult(err == nil)
+				p.reporter.ImageDone(relPath, j.index+1, len(items), err)
+			}
+		}()
+	}
+
+	for i := range items {
+		jobs <- job{item: &items[i], index: i}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return nil
+}
+
+// processManifestImage resizes and re-encodes a single manifest item. If the
+// encoder changed its extension, the manifest and its references are
+// rewritten under mu so concurrent workers don't race on the shared OPF and
+// XHTML/CSS files.
+func (p *EPUBProcessor) processManifestImage(manifest *opf.Manifest, item *opf.Item, mu *sync.Mutex) error {
+	path, err := manifest.Path(*item)
+	if err != nil {
+		return err
+	}
+
+	if p.config.UseImageMagick {
+		return p.processImageMagick(path)
+	}
+
+	outPath, err := p.processImageGo(path)
+	if err != nil {
+		return err
+	}
+	if outPath == path {
+		return nil
+	}
+
+	newExt := filepath.Ext(outPath)
+	newHref := strings.TrimSuffix(item.Href, filepath.Ext(item.Href)) + newExt
+	newMediaType := mediaTypeForExt(newExt)
+
+	mu.Lock()
+	defer mu.Unlock()
+	return manifest.RenameItem(item, newHref, newMediaType)
+}
@@ -2,12 +2,16 @@ package main
 
 import (
 	"archive/zip"
+	"flag"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -16,12 +20,32 @@ type Config struct {
 	ResizePercent int
 	Quality       int
 	BackupDir     string
+
+	// Encoder selects the pure-Go output format ("jpeg", "png", "webp" or
+	// "avif"). The zero value, EncoderAuto, keeps each image's original
+	// format.
+	Encoder Encoder
+
+	// UseImageMagick falls back to shelling out to the `magick` CLI instead
+	// of the pure-Go pipeline, for environments where it's already
+	// installed and trusted.
+	UseImageMagick bool
+
+	// Concurrency is the number of images processed in parallel. Zero (the
+	// default) uses runtime.NumCPU().
+	Concurrency int
+
+	// DryRun reports projected size savings via Analyze instead of writing
+	// any output.
+	DryRun bool
 }
 
 // EPUBProcessor handles EPUB file processing
 type EPUBProcessor struct {
-	config Config
-	stats  ProcessingStats
+	config   Config
+	reporter Reporter
+	stats    ProcessingStats
+	statsMu  sync.Mutex
 }
 
 // ProcessingStats tracks processing statistics
@@ -41,6 +65,28 @@ func NewEPUBProcessor() *EPUBProcessor {
 			Quality:       85,
 			BackupDir:     fmt.Sprintf("originals_%s", time.Now().Format("20060102_150405")),
 		},
+		reporter: NewTextReporter(os.Stdout),
+	}
+}
+
+// recordSize adds origDelta/newDelta to the running size totals. It is safe
+// to call concurrently from worker goroutines.
+func (p *EPUBProcessor) recordSize(origDelta, newDelta int64) {
+	p.statsMu.Lock()
+	defer p.statsMu.Unlock()
+	p.stats.OriginalSize += origDelta
+	p.stats.NewSize += newDelta
+}
+
+// recordResult records the outcome of processing one image. It is safe to
+// call concurrently from worker goroutines.
+func (p *EPUBProcessor) recordResult(success bool) {
+	p.statsMu.Lock()
+	defer p.statsMu.Unlock()
+	if success {
+		p.stats.ProcessedImages++
+	} else {
+		p.stats.FailedImages++
 	}
 }
 
@@ -74,6 +120,12 @@ func (p *EPUBProcessor) extractEPUB(epubPath string) (string, error) {
 	for _, file := range reader.File {
 		path := filepath.Join(tempDir, file.Name)
 
+		// Zip-slip protection: reject entries whose cleaned path would land
+		// outside tempDir (e.g. "../../etc/passwd").
+		if !strings.HasPrefix(path, filepath.Clean(tempDir)+string(os.PathSeparator)) {
+			return "", fmt.Errorf("illegal file path in EPUB: %s", file.Name)
+		}
+
 		// Create directory if needed
 		if file.FileInfo().IsDir() {
 			os.MkdirAll(path, file.Mode())
@@ -112,45 +164,26 @@ func (p *EPUBProcessor) extractFile(file *zip.File, destPath string) error {
 	return err
 }
 
-// isImageFile checks if a file is an image based on extension
-func isImageFile(path string) bool {
-	ext := strings.ToLower(filepath.Ext(path))
-	imageExts := []string{".jpg", ".jpeg", ".png", ".gif", ".bmp", ".tiff", ".webp"}
-	for _, imgExt := range imageExts {
-		if ext == imgExt {
-			return true
-		}
-	}
-	return false
-}
-
-// processImage resizes a single image using ImageMagick
-func (p *EPUBProcessor) processImage(imagePath string) error {
+// processImageMagick resizes a single image by shelling out to ImageMagick
+func (p *EPUBProcessor) processImageMagick(imagePath string) error {
 	// Get original dimensions
 	cmd := exec.Command("magick", "identify", "-format", "%wx%h %B", imagePath)
 	output, err := cmd.Output()
 	if err != nil {
 		return fmt.Errorf("failed to get image info: %w", err)
 	}
-	
-	parts := strings.Fields(string(output))
-	if len(parts) >= 1 {
-		fmt.Printf("  Original: %s", parts[0])
-		if len(parts) >= 2 {
-			fmt.Printf(" (%s bytes)", parts[1])
-		}
-		fmt.Println()
-	}
+
+	p.reporter.Status("  " + formatImageMagickInfo("Original", string(output)))
 
 	// Create temporary resized file
 	tempPath := imagePath + ".tmp"
-	
+
 	// Resize image
-	cmd = exec.Command("magick", imagePath, 
+	cmd = exec.Command("magick", imagePath,
 		"-resize", fmt.Sprintf("%d%%", p.config.ResizePercent),
 		"-quality", fmt.Sprintf("%d", p.config.Quality),
 		tempPath)
-	
+
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("failed to resize image: %w", err)
 	}
@@ -162,15 +195,8 @@ func (p *EPUBProcessor) processImage(imagePath string) error {
 		os.Remove(tempPath)
 		return fmt.Errorf("failed to get new image info: %w", err)
 	}
-	
-	parts = strings.Fields(string(output))
-	if len(parts) >= 1 {
-		fmt.Printf("  New: %s", parts[0])
-		if len(parts) >= 2 {
-			fmt.Printf(" (%s bytes)", parts[1])
-		}
-		fmt.Println()
-	}
+
+	p.reporter.Status("  " + formatImageMagickInfo("New", string(output)))
 
 	// Replace original with resized
 	if err := os.Rename(tempPath, imagePath); err != nil {
@@ -181,53 +207,38 @@ func (p *EPUBProcessor) processImage(imagePath string) error {
 	return nil
 }
 
-// processImagesInDir processes all images in a directory
-func (p *EPUBProcessor) processImagesInDir(dirPath string) error {
-	var imageFiles []string
-
-	// Walk through directory to find all images
-	err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if !info.IsDir() && isImageFile(path) {
-			imageFiles = append(imageFiles, path)
-			p.stats.TotalImages++
-		}
-		return nil
-	})
-
-	if err != nil {
-		return fmt.Errorf("failed to walk directory: %w", err)
+// formatImageMagickInfo turns `magick identify -format "%wx%h %B"` output
+// into a "label: WxH (N bytes)" status line.
+func formatImageMagickInfo(label, output string) string {
+	parts := strings.Fields(output)
+	if len(parts) == 0 {
+		return label + ": unknown"
 	}
-
-	if len(imageFiles) == 0 {
-		fmt.Println("No images found to process")
-		return nil
+	if len(parts) >= 2 {
+		return fmt.Sprintf("%s: %s (%s bytes)", label, parts[0], parts[1])
 	}
+	return fmt.Sprintf("%s: %s", label, parts[0])
+}
 
-	fmt.Printf("\nFound %d image(s) to process\n\n", len(imageFiles))
-
-	// Process each image
-	for i, imagePath := range imageFiles {
-		relPath, _ := filepath.Rel(dirPath, imagePath)
-		fmt.Printf("[%d/%d] Processing: %s\n", i+1, len(imageFiles), relPath)
-		
-		if err := p.processImage(imagePath); err != nil {
-			fmt.Printf("  ✗ Failed: %v\n", err)
-			p.stats.FailedImages++
-		} else {
-			fmt.Printf("  ✓ Success\n")
-			p.stats.ProcessedImages++
-		}
-		fmt.Println()
+// workerConcurrency clamps Config.Concurrency (0 meaning "use all CPUs") to
+// the number of jobs actually available, so a handful of images never
+// spins up more idle goroutines than there is work to hand them.
+func (p *EPUBProcessor) workerConcurrency(jobCount int) int {
+	concurrency := p.config.Concurrency
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
 	}
-
-	return nil
+	if concurrency > jobCount {
+		concurrency = jobCount
+	}
+	return concurrency
 }
 
-// createEPUB creates a new EPUB file from a directory
-func (p *EPUBProcessor) createEPUB(sourceDir, outputPath string) error {
+// zipDirectory zips sourceDir into outputPath. If sourceDir contains a
+// "mimetype" file it's written first and uncompressed, as the EPUB spec
+// requires; CBR extraction directories have no such file, so that step is
+// simply skipped for them.
+func (p *EPUBProcessor) zipDirectory(sourceDir, outputPath string) error {
 	// Create output file
 	outFile, err := os.Create(outputPath)
 	if err != nil {
@@ -315,108 +326,198 @@ func (p *EPUBProcessor) createEPUB(sourceDir, outputPath string) error {
 	return nil
 }
 
-// ProcessEPUBFile is the main processing function
-func (p *EPUBProcessor) ProcessEPUBFile(epubPath string) error {
-	fmt.Printf("Processing EPUB: %s\n", epubPath)
-	fmt.Println(strings.Repeat("-", 50))
-
-	// Check if ImageMagick is installed
-	if err := p.checkImageMagick(); err != nil {
-		return err
-	}
-
-	// Extract EPUB
-	fmt.Println("Extracting EPUB...")
+// processEPUBViaTempDir processes epubPath by extracting it to a temporary
+// directory first, for Config.UseImageMagick: the `magick` CLI needs real
+// files on disk, so this path can't stream through processImageStream like
+// the default pure-Go pipeline does.
+func (p *EPUBProcessor) processEPUBViaTempDir(epubPath, outputPath string) error {
+	p.reporter.Status("Extracting EPUB...")
 	tempDir, err := p.extractEPUB(epubPath)
 	if err != nil {
 		return fmt.Errorf("extraction failed: %w", err)
 	}
 	defer os.RemoveAll(tempDir) // Cleanup temp directory
 
-	// Process images
-	fmt.Println("Processing images...")
-	if err := p.processImagesInDir(tempDir); err != nil {
+	p.reporter.Status("Processing images...")
+	if err := p.processManifestImages(tempDir); err != nil {
 		return fmt.Errorf("image processing failed: %w", err)
 	}
 
-	// Create output filename
-	dir := filepath.Dir(epubPath)
-	base := filepath.Base(epubPath)
+	p.reporter.Status("Creating compressed EPUB...")
+	if err := p.zipDirectory(tempDir, outputPath); err != nil {
+		return fmt.Errorf("EPUB creation failed: %w", err)
+	}
+
+	return nil
+}
+
+// ProcessFile is the main processing function. It dispatches to the
+// Container matching inputPath's extension (EPUB, CBZ or CBR) and prints a
+// size summary once processing completes.
+func (p *EPUBProcessor) ProcessFile(inputPath string) error {
+	p.reporter.Status(fmt.Sprintf("Processing: %s", inputPath))
+	p.reporter.Status(strings.Repeat("-", 50))
+
+	container, err := containerForPath(inputPath)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(inputPath)
+	base := filepath.Base(inputPath)
 	ext := filepath.Ext(base)
 	nameWithoutExt := strings.TrimSuffix(base, ext)
-	outputPath := filepath.Join(dir, fmt.Sprintf("%s_compressed%s", nameWithoutExt, ext))
+	outputPath := filepath.Join(dir, fmt.Sprintf("%s_compressed%s", nameWithoutExt, container.OutputExt(ext)))
 
-	// Create new EPUB
-	fmt.Println("Creating compressed EPUB...")
-	if err := p.createEPUB(tempDir, outputPath); err != nil {
-		return fmt.Errorf("EPUB creation failed: %w", err)
+	p.reporter.Status("Processing images...")
+	if err := container.Process(p, inputPath, outputPath); err != nil {
+		return err
 	}
 
 	// Get file sizes for comparison
-	originalInfo, _ := os.Stat(epubPath)
+	originalInfo, _ := os.Stat(inputPath)
 	newInfo, _ := os.Stat(outputPath)
 
-	// Print summary
-	fmt.Println(strings.Repeat("-", 50))
-	fmt.Println("PROCESSING COMPLETE!")
-	fmt.Printf("Images processed: %d/%d\n", p.stats.ProcessedImages, p.stats.TotalImages)
-	if p.stats.FailedImages > 0 {
-		fmt.Printf("Failed: %d\n", p.stats.FailedImages)
-	}
-	fmt.Printf("Original EPUB size: %.2f MB\n", float64(originalInfo.Size())/(1024*1024))
-	fmt.Printf("New EPUB size: %.2f MB\n", float64(newInfo.Size())/(1024*1024))
-	fmt.Printf("Size reduction: %.1f%%\n", 
-		(1-float64(newInfo.Size())/float64(originalInfo.Size()))*100)
-	fmt.Printf("Output: %s\n", outputPath)
+	p.reporter.Status(strings.Repeat("-", 50))
+	p.reporter.Status("PROCESSING COMPLETE!")
+	p.reporter.Summary(p.stats)
+	p.reporter.Status(fmt.Sprintf("Original size: %.2f MB", float64(originalInfo.Size())/(1024*1024)))
+	p.reporter.Status(fmt.Sprintf("New size: %.2f MB", float64(newInfo.Size())/(1024*1024)))
+	p.reporter.Status(fmt.Sprintf("Size reduction: %.1f%%",
+		(1-float64(newInfo.Size())/float64(originalInfo.Size()))*100))
+	p.reporter.Status(fmt.Sprintf("Output: %s", outputPath))
 
 	return nil
 }
 
-// ProcessMultipleEPUBs processes multiple EPUB files
+// ProcessMultipleEPUBs processes every file matching pattern, which may mix
+// formats via a brace group such as "*.{epub,cbz,cbr}".
 func (p *EPUBProcessor) ProcessMultipleEPUBs(pattern string) error {
-	files, err := filepath.Glob(pattern)
+	files, err := globFiles(pattern)
 	if err != nil {
-		return fmt.Errorf("invalid pattern: %w", err)
+		return err
 	}
 
 	if len(files) == 0 {
-		return fmt.Errorf("no EPUB files found matching pattern: %s", pattern)
+		return fmt.Errorf("no files found matching pattern: %s", pattern)
 	}
 
-	fmt.Printf("Found %d EPUB file(s) to process\n\n", len(files))
+	p.reporter.Status(fmt.Sprintf("Found %d file(s) to process\n", len(files)))
 
 	for i, file := range files {
-		fmt.Printf("\n[%d/%d] ", i+1, len(files))
-		
+		p.reporter.Status(fmt.Sprintf("[%d/%d]", i+1, len(files)))
+
 		// Reset stats for each file
 		p.stats = ProcessingStats{}
-		
-		if err := p.ProcessEPUBFile(file); err != nil {
-			fmt.Printf("Error processing %s: %v\n", file, err)
+
+		if err := p.ProcessFile(file); err != nil {
+			p.reporter.Status(fmt.Sprintf("Error processing %s: %v", file, err))
 		}
-		
+
 		if i < len(files)-1 {
-			fmt.Println("\n" + strings.Repeat("=", 50))
+			p.reporter.Status("\n" + strings.Repeat("=", 50))
 		}
 	}
 
 	return nil
 }
 
+// globFiles expands pattern and returns the matching files, deduplicated
+// and sorted. pattern may contain a single brace list like
+// "*.{epub,cbz,cbr}", which filepath.Glob doesn't support natively.
+func globFiles(pattern string) ([]string, error) {
+	seen := make(map[string]bool)
+	var files []string
+	for _, pat := range expandBraces(pattern) {
+		matches, err := filepath.Glob(pat)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern: %w", err)
+		}
+		for _, m := range matches {
+			if !seen[m] {
+				seen[m] = true
+				files = append(files, m)
+			}
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// expandBraces expands a single "{a,b,c}" group in pattern into one
+// pattern per option, e.g. "*.{epub,cbz}" becomes ["*.epub", "*.cbz"].
+// Patterns without a brace group are returned unchanged.
+func expandBraces(pattern string) []string {
+	start := strings.IndexByte(pattern, '{')
+	end := strings.IndexByte(pattern, '}')
+	if start < 0 || end < start {
+		return []string{pattern}
+	}
+
+	prefix, suffix := pattern[:start], pattern[end+1:]
+	options := strings.Split(pattern[start+1:end], ",")
+	patterns := make([]string, len(options))
+	for i, opt := range options {
+		patterns[i] = prefix + opt + suffix
+	}
+	return patterns
+}
+
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Fprintf(os.Stderr, "Usage: %s <epub-file-or-pattern>\n", os.Args[0])
+	reporterFlag := flag.String("reporter", "text", "progress reporter: text, json, or silent")
+	concurrency := flag.Int("concurrency", 0, "number of images to process in parallel (default: number of CPUs)")
+	encoder := flag.String("encoder", "", "re-encode images to this format: jpeg, png, webp, avif (default: keep original format)")
+	dryRun := flag.Bool("dry-run", false, "report projected size savings without writing any output")
+	jsonOutput := flag.Bool("json", false, "emit the dry-run report as JSON (only applies with -dry-run)")
+	useImageMagick := flag.Bool("use-imagemagick", false, "shell out to the `magick` CLI instead of the pure-Go pipeline (requires ImageMagick to be installed)")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] <file-or-pattern>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Supported formats: .epub, .cbz, .cbr\n")
 		fmt.Fprintf(os.Stderr, "Examples:\n")
-		fmt.Fprintf(os.Stderr, "  %s book.epub           # Process single file\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "  %s '*.epub'            # Process all EPUB files\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "  %s 'books/*.epub'      # Process EPUB files in books directory\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s book.epub                # Process single file\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s '*.epub'                  # Process all EPUB files\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s 'books/*.epub'            # Process EPUB files in books directory\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s '*.{epub,cbz,cbr}'        # Process mixed EPUB/CBZ/CBR files\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -dry-run -json book.epub  # Report projected savings as JSON\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\nFlags:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		flag.Usage()
 		os.Exit(1)
 	}
 
 	processor := NewEPUBProcessor()
+	processor.config.Concurrency = *concurrency
+	processor.config.Encoder = Encoder(*encoder)
+	processor.config.DryRun = *dryRun
+	processor.config.UseImageMagick = *useImageMagick
+
+	switch *reporterFlag {
+	case "json":
+		processor.reporter = NewJSONReporter(os.Stdout)
+	case "silent":
+		processor.reporter = NewSilentReporter()
+	case "text":
+		// already the default
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown reporter %q (want text, json, or silent)\n", *reporterFlag)
+		os.Exit(1)
+	}
 
 	// Check if input is a single file or pattern
-	input := os.Args[1]
+	input := flag.Arg(0)
+
+	if processor.config.DryRun {
+		if err := runAnalysis(processor, input, *jsonOutput); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	if strings.Contains(input, "*") {
 		// Process multiple files
 		if err := processor.ProcessMultipleEPUBs(input); err != nil {
@@ -425,7 +526,7 @@ func main() {
 		}
 	} else {
 		// Process single file
-		if err := processor.ProcessEPUBFile(input); err != nil {
+		if err := processor.ProcessFile(input); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
@@ -0,0 +1,185 @@
+// Package opf parses the OPF package document referenced by an EPUB's
+// META-INF/container.xml, so callers can discover exactly which files the
+// manifest declares as images instead of guessing from file extensions.
+package opf
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Item is a manifest entry whose media-type identifies it as an image.
+type Item struct {
+	ID        string
+	Href      string // relative to the OPF document's directory
+	MediaType string
+	IsCover   bool
+}
+
+// Manifest describes the image items of one EPUB, as extracted to a
+// directory on disk.
+type Manifest struct {
+	// Root is the directory the EPUB was extracted into.
+	Root string
+	// OPFPath is the path to the OPF document, relative to Root.
+	OPFPath string
+	// Items holds every manifest entry with an image media-type.
+	Items []Item
+}
+
+var imageMediaTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/bmp":  true,
+	"image/webp": true,
+	"image/avif": true,
+}
+
+type xmlContainer struct {
+	RootFiles struct {
+		RootFile []struct {
+			FullPath string `xml:"full-path,attr"`
+		} `xml:"rootfile"`
+	} `xml:"rootfiles"`
+}
+
+type xmlPackage struct {
+	Metadata struct {
+		Meta []struct {
+			Name    string `xml:"name,attr"`
+			Content string `xml:"content,attr"`
+		} `xml:"meta"`
+	} `xml:"metadata"`
+	Manifest struct {
+		Item []struct {
+			ID         string `xml:"id,attr"`
+			Href       string `xml:"href,attr"`
+			MediaType  string `xml:"media-type,attr"`
+			Properties string `xml:"properties,attr"`
+		} `xml:"item"`
+	} `xml:"manifest"`
+}
+
+// ParseContainer reads a META-INF/container.xml document and returns the
+// slash-separated path (as written in the XML) of its first rootfile.
+func ParseContainer(data []byte) (string, error) {
+	var c xmlContainer
+	if err := xml.Unmarshal(data, &c); err != nil {
+		return "", fmt.Errorf("parse container.xml: %w", err)
+	}
+	if len(c.RootFiles.RootFile) == 0 {
+		return "", fmt.Errorf("container.xml declares no rootfile")
+	}
+	fullPath := c.RootFiles.RootFile[0].FullPath
+	if err := ValidateBookPath(fullPath); err != nil {
+		return "", fmt.Errorf("container.xml: %w", err)
+	}
+	return fullPath, nil
+}
+
+// ValidateBookPath rejects a book-root-relative, slash-separated path (as
+// used for zip entry names and container.xml's rootfile full-path) that is
+// absolute or escapes the root via "../" segments, the zip-internal
+// counterpart to the filesystem hardening resolveWithinRoot applies once
+// such a path is joined onto a real directory.
+func ValidateBookPath(p string) error {
+	cleaned := path.Clean(p)
+	if path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return fmt.Errorf("illegal path %q", p)
+	}
+	return nil
+}
+
+// ParseManifest reads an OPF package document and returns its manifest
+// items whose media-type identifies them as images.
+func ParseManifest(data []byte) ([]Item, error) {
+	var pkg xmlPackage
+	if err := xml.Unmarshal(data, &pkg); err != nil {
+		return nil, fmt.Errorf("parse OPF document: %w", err)
+	}
+
+	coverID := ""
+	for _, meta := range pkg.Metadata.Meta {
+		if meta.Name == "cover" {
+			coverID = meta.Content
+		}
+	}
+
+	var items []Item
+	for _, it := range pkg.Manifest.Item {
+		if !imageMediaTypes[strings.ToLower(it.MediaType)] {
+			continue
+		}
+		items = append(items, Item{
+			ID:        it.ID,
+			Href:      it.Href,
+			MediaType: it.MediaType,
+			IsCover:   it.ID == coverID || strings.Contains(it.Properties, "cover-image"),
+		})
+	}
+
+	return items, nil
+}
+
+// Parse locates META-INF/container.xml under root, reads the OPF document it
+// points to, and returns the manifest's image items.
+func Parse(root string) (*Manifest, error) {
+	containerData, err := os.ReadFile(filepath.Join(root, "META-INF", "container.xml"))
+	if err != nil {
+		return nil, fmt.Errorf("read container.xml: %w", err)
+	}
+
+	opfSlashPath, err := ParseContainer(containerData)
+	if err != nil {
+		return nil, err
+	}
+	opfRelPath := filepath.FromSlash(opfSlashPath)
+
+	opfPath, err := resolveWithinRoot(root, opfRelPath)
+	if err != nil {
+		return nil, fmt.Errorf("container.xml: %w", err)
+	}
+
+	opfData, err := os.ReadFile(opfPath)
+	if err != nil {
+		return nil, fmt.Errorf("read OPF document %s: %w", opfRelPath, err)
+	}
+
+	items, err := ParseManifest(opfData)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", opfRelPath, err)
+	}
+
+	return &Manifest{Root: root, OPFPath: opfRelPath, Items: items}, nil
+}
+
+// resolveWithinRoot joins root and rel (an OS-native relative path) and
+// rejects the result if it would land outside root, e.g. via "../"
+// segments in a malicious or malformed container.xml/manifest. This is the
+// same zip-slip-style hardening extractEPUB applies to raw zip entry names.
+func resolveWithinRoot(root, rel string) (string, error) {
+	cleanRoot := filepath.Clean(root)
+	resolved := filepath.Join(cleanRoot, rel)
+	if resolved != cleanRoot && !strings.HasPrefix(resolved, cleanRoot+string(os.PathSeparator)) {
+		return "", fmt.Errorf("illegal path %q escapes %s", rel, root)
+	}
+	return resolved, nil
+}
+
+// Path returns the absolute filesystem path of item, resolved relative to
+// the OPF document's directory as the EPUB spec requires. It returns an
+// error if item.Href would resolve outside Root (e.g. via "../" segments in
+// a malicious or malformed manifest), the same hardening extractEPUB
+// applies to raw zip entry names.
+func (m *Manifest) Path(item Item) (string, error) {
+	resolved, err := resolveWithinRoot(m.Root, filepath.Join(filepath.Dir(m.OPFPath), filepath.FromSlash(item.Href)))
+	if err != nil {
+		return "", fmt.Errorf("manifest item %s: %w", item.ID, err)
+	}
+	return resolved, nil
+}
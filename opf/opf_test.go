@@ -0,0 +1,208 @@
+package opf
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const sampleContainer = `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>`
+
+const samplePackage = `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" unique-identifier="bookid">
+  <metadata>
+    <meta name="cover" content="img-cover"/>
+  </metadata>
+  <manifest>
+    <item id="img-cover" href="images/cover.jpg" media-type="image/jpeg"/>
+    <item id="img-1" href="images/ch1/page.png" media-type="image/png"/>
+    <item id="chap1" href="text/chapter1.xhtml" media-type="application/xhtml+xml"/>
+  </manifest>
+</package>`
+
+func TestParseContainer(t *testing.T) {
+	got, err := ParseContainer([]byte(sampleContainer))
+	if err != nil {
+		t.Fatalf("ParseContainer: %v", err)
+	}
+	if got != "OEBPS/content.opf" {
+		t.Errorf("got %q, want %q", got, "OEBPS/content.opf")
+	}
+}
+
+func TestParseManifest(t *testing.T) {
+	items, err := ParseManifest([]byte(samplePackage))
+	if err != nil {
+		t.Fatalf("ParseManifest: %v", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("got %d image items, want 2: %+v", len(items), items)
+	}
+	if items[0].Href != "images/cover.jpg" || !items[0].IsCover {
+		t.Errorf("cover item = %+v, want href images/cover.jpg, IsCover true", items[0])
+	}
+	if items[1].Href != "images/ch1/page.png" || items[1].IsCover {
+		t.Errorf("second item = %+v, want href images/ch1/page.png, IsCover false", items[1])
+	}
+}
+
+func TestManifestPathRejectsTraversal(t *testing.T) {
+	root := t.TempDir()
+	m := &Manifest{Root: root, OPFPath: "OEBPS/content.opf"}
+
+	if _, err := m.Path(Item{ID: "ok", Href: "images/cover.jpg"}); err != nil {
+		t.Errorf("expected well-formed href to resolve, got error: %v", err)
+	}
+
+	_, err := m.Path(Item{ID: "evil", Href: "../../../etc/passwd"})
+	if err == nil {
+		t.Fatal("expected error for href escaping Root, got nil")
+	}
+}
+
+// TestParseRejectsContainerTraversal is a regression test for a bug where
+// container.xml's rootfile full-path was joined onto Root without
+// validation, letting a malicious "../../../../tmp/x/evil.opf" full-path
+// make Parse read an arbitrary file outside the EPUB.
+func TestParseRejectsContainerTraversal(t *testing.T) {
+	root := t.TempDir()
+	mustWrite(t, filepath.Join(root, "META-INF", "container.xml"), `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="../../../../etc/evil.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>`)
+
+	if _, err := Parse(root); err == nil {
+		t.Fatal("expected error for container.xml full-path escaping root, got nil")
+	}
+}
+
+func TestValidateBookPath(t *testing.T) {
+	for _, ok := range []string{"OEBPS/content.opf", "content.opf", "a/b/c.xhtml"} {
+		if err := ValidateBookPath(ok); err != nil {
+			t.Errorf("ValidateBookPath(%q) = %v, want nil", ok, err)
+		}
+	}
+	for _, bad := range []string{"../evil.opf", "../../etc/passwd", "/etc/passwd", "a/../../evil.opf"} {
+		if err := ValidateBookPath(bad); err == nil {
+			t.Errorf("ValidateBookPath(%q) = nil, want error", bad)
+		}
+	}
+}
+
+func TestRewriteOPFItem(t *testing.T) {
+	updated, err := RewriteOPFItem([]byte(samplePackage), "images/ch1/page.png", "images/ch1/page.webp", "image/webp")
+	if err != nil {
+		t.Fatalf("RewriteOPFItem: %v", err)
+	}
+	items, err := ParseManifest(updated)
+	if err != nil {
+		t.Fatalf("ParseManifest of rewritten data: %v", err)
+	}
+	if items[1].Href != "images/ch1/page.webp" || items[1].MediaType != "image/webp" {
+		t.Errorf("got %+v, want href images/ch1/page.webp media-type image/webp", items[1])
+	}
+
+	if _, err := RewriteOPFItem([]byte(samplePackage), "no/such/href.png", "x.png", "image/png"); err == nil {
+		t.Error("expected error for missing href, got nil")
+	}
+}
+
+// TestRewriteReferenceSameBasenameDifferentDirectories is a regression test
+// for a bug where references were rewritten by basename alone: a document
+// referencing "ch2/page.png" must not be touched by a rename of
+// "ch1/page.png", even though both share the basename "page.png".
+func TestRewriteReferenceSameBasenameDifferentDirectories(t *testing.T) {
+	data := []byte(`<html><body>
+<img src="../images/ch1/page.png"/>
+<img src="../images/ch2/page.png"/>
+</body></html>`)
+
+	out := RewriteReference(data, "OEBPS/text", "OEBPS/images/ch1/page.png", "OEBPS/images/ch1/page.webp")
+
+	want := `<html><body>
+<img src="../images/ch1/page.webp"/>
+<img src="../images/ch2/page.png"/>
+</body></html>`
+	if string(out) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestRewriteReferenceCSSURL(t *testing.T) {
+	data := []byte(`body { background: url('images/bg.png'); }`)
+	out := RewriteReference(data, "OEBPS", "OEBPS/images/bg.png", "OEBPS/images/bg.webp")
+	want := `body { background: url('images/bg.webp'); }`
+	if string(out) != want {
+		t.Errorf("got %q, want %q", out, want)
+	}
+}
+
+func TestRenameItemRewritesOnlyMatchingReference(t *testing.T) {
+	root := t.TempDir()
+	mustWrite(t, filepath.Join(root, "META-INF", "container.xml"), sampleContainer)
+	mustWrite(t, filepath.Join(root, "OEBPS", "content.opf"), samplePackage)
+	mustWrite(t, filepath.Join(root, "OEBPS", "text", "chapter1.xhtml"), `<html><body>
+<img src="../images/ch1/page.png"/>
+</body></html>`)
+	mustWrite(t, filepath.Join(root, "OEBPS", "images", "ch1", "page.png"), "")
+	// A second, unrelated image sharing the basename "page.png" in a sibling
+	// directory that is not itself part of the manifest under test.
+	mustWrite(t, filepath.Join(root, "OEBPS", "images", "ch2", "other.xhtml"), `<img src="../ch2/page.png"/>`)
+	mustWrite(t, filepath.Join(root, "OEBPS", "images", "ch2", "page.png"), "")
+
+	manifest, err := Parse(root)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	var pageItem *Item
+	for i := range manifest.Items {
+		if manifest.Items[i].Href == "images/ch1/page.png" {
+			pageItem = &manifest.Items[i]
+		}
+	}
+	if pageItem == nil {
+		t.Fatalf("manifest item for images/ch1/page.png not found: %+v", manifest.Items)
+	}
+
+	if err := manifest.RenameItem(pageItem, "images/ch1/page.webp", "image/webp"); err != nil {
+		t.Fatalf("RenameItem: %v", err)
+	}
+
+	chapter := mustRead(t, filepath.Join(root, "OEBPS", "text", "chapter1.xhtml"))
+	if got, want := string(chapter), "../images/ch1/page.webp"; !strings.Contains(got, want) {
+		t.Errorf("chapter1.xhtml not rewritten: %s", got)
+	}
+
+	other := mustRead(t, filepath.Join(root, "OEBPS", "images", "ch2", "other.xhtml"))
+	if !strings.Contains(string(other), "../ch2/page.png") {
+		t.Errorf("unrelated same-basename reference was incorrectly rewritten: %s", other)
+	}
+}
+
+func mustWrite(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustRead(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
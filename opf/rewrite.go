@@ -0,0 +1,150 @@
+package opf
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+)
+
+// referencingExts lists the file types that may hold a reference to an
+// image: XHTML content documents and stylesheets (for background-image
+// etc.). The OPF document itself is handled separately, since its item
+// element needs its media-type attribute updated too.
+var referencingExts = map[string]bool{
+	".xhtml": true,
+	".html":  true,
+	".htm":   true,
+	".css":   true,
+}
+
+// IsReferencingPath reports whether path is a content document or
+// stylesheet that might reference an image (as opposed to the image or OPF
+// document itself).
+func IsReferencingPath(path string) bool {
+	return referencingExts[filepath.Ext(path)]
+}
+
+// RewriteOPFItem returns opfData with the manifest <item> whose href is
+// oldHref updated to newHref/newMediaType.
+func RewriteOPFItem(opfData []byte, oldHref, newHref, newMediaType string) ([]byte, error) {
+	itemRe := regexp.MustCompile(`<item\b[^>]*\bhref="` + regexp.QuoteMeta(oldHref) + `"[^>]*/?>`)
+	tag := itemRe.Find(opfData)
+	if tag == nil {
+		return nil, fmt.Errorf("manifest item with href %q not found", oldHref)
+	}
+
+	hrefRe := regexp.MustCompile(`href="` + regexp.QuoteMeta(oldHref) + `"`)
+	mediaTypeRe := regexp.MustCompile(`media-type="[^"]*"`)
+
+	newTag := hrefRe.ReplaceAll(tag, []byte(`href="`+newHref+`"`))
+	newTag = mediaTypeRe.ReplaceAll(newTag, []byte(`media-type="`+newMediaType+`"`))
+
+	return itemRe.ReplaceAll(opfData, escapeReplacement(newTag)), nil
+}
+
+// RewriteReference rewrites quoted and url(...) references in data, a
+// content document or stylesheet living in docDir (slash-separated, relative
+// to the EPUB root), that resolve to oldBookPath (also root-relative) so
+// they resolve to newBookPath instead. Resolving each candidate reference
+// against docDir before rewriting it (rather than matching its basename
+// against every occurrence in the file) keeps this correct when two images
+// share a filename in different directories, e.g. "ch1/page.png" and
+// "ch2/page.png".
+func RewriteReference(data []byte, docDir, oldBookPath, newBookPath string) []byte {
+	if oldBookPath == newBookPath {
+		return data
+	}
+	oldBase, newBase := path.Base(oldBookPath), path.Base(newBookPath)
+	pattern := regexp.MustCompile(`([("'])([^"'()]*?)` + regexp.QuoteMeta(oldBase) + `(["')])`)
+	if !pattern.Match(data) {
+		return data
+	}
+	return pattern.ReplaceAllFunc(data, func(m []byte) []byte {
+		sub := pattern.FindSubmatch(m)
+		prefix := string(sub[2])
+		if path.Clean(path.Join(docDir, prefix+oldBase)) != oldBookPath {
+			return m
+		}
+		return append(append(append([]byte{}, sub[1]...), []byte(prefix+newBase)...), sub[3]...)
+	})
+}
+
+// RenameItem updates item's href/media-type in the OPF manifest on disk and
+// rewrites every <img src>, <image xlink:href> and CSS url(...) reference to
+// it throughout the EPUB, then updates item in place. The cover designation
+// (by id or "cover-image" property) is untouched, since it never depended on
+// the href.
+func (m *Manifest) RenameItem(item *Item, newHref, newMediaType string) error {
+	oldHref := item.Href
+	if oldHref == newHref {
+		item.MediaType = newMediaType
+		return nil
+	}
+
+	opfPath := filepath.Join(m.Root, m.OPFPath)
+	opfData, err := os.ReadFile(opfPath)
+	if err != nil {
+		return fmt.Errorf("read OPF document: %w", err)
+	}
+	opfData, err = RewriteOPFItem(opfData, oldHref, newHref, newMediaType)
+	if err != nil {
+		return fmt.Errorf("%s: %w", m.OPFPath, err)
+	}
+	if err := os.WriteFile(opfPath, opfData, 0644); err != nil {
+		return fmt.Errorf("write OPF document: %w", err)
+	}
+
+	if err := m.rewriteReferencesOnDisk(oldHref, newHref); err != nil {
+		return err
+	}
+
+	item.Href = newHref
+	item.MediaType = newMediaType
+	return nil
+}
+
+// rewriteReferencesOnDisk applies RewriteReference to every referencing file
+// under Root, resolving oldHref/newHref (relative to the OPF document's
+// directory, as manifest hrefs are) to book-root-relative paths first so
+// each candidate reference is matched by where it actually points.
+func (m *Manifest) rewriteReferencesOnDisk(oldHref, newHref string) error {
+	if oldHref == newHref {
+		return nil
+	}
+	opfDir := path.Dir(filepath.ToSlash(m.OPFPath))
+	oldBookPath := path.Clean(path.Join(opfDir, oldHref))
+	newBookPath := path.Clean(path.Join(opfDir, newHref))
+
+	return filepath.Walk(m.Root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !IsReferencingPath(p) {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(m.Root, p)
+		if err != nil {
+			return err
+		}
+		docDir := path.Dir(filepath.ToSlash(relPath))
+
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", p, err)
+		}
+		updated := RewriteReference(data, docDir, oldBookPath, newBookPath)
+		if string(updated) == string(data) {
+			return nil
+		}
+		return os.WriteFile(p, updated, info.Mode())
+	})
+}
+
+// escapeReplacement escapes $ so regexp.ReplaceAll treats replacement as a
+// literal byte string rather than a submatch template.
+func escapeReplacement(b []byte) []byte {
+	return regexp.MustCompile(`\$`).ReplaceAll(b, []byte(`$$`))
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Reporter receives progress events while images are processed, decoupling
+// EPUBProcessor from any particular output format so callers embedding this
+// package (or driving it from CI) aren't stuck parsing stdout.
+type Reporter interface {
+	// ImageStart is called when a worker picks up an image.
+	ImageStart(relPath string, index, total int)
+	// ImageDone is called when a worker finishes an image, err is nil on success.
+	ImageDone(relPath string, index, total int, err error)
+	// Summary is called once after all images in a directory have been processed.
+	Summary(stats ProcessingStats)
+	// Status reports a one-line progress update not tied to a specific
+	// image, such as "Processing: book.epub" or "Found 12 image(s) to
+	// process".
+	Status(message string)
+	// Report is called once Analyze has finished with a dry-run file.
+	Report(report *AnalysisReport)
+}
+
+// textReporter reproduces the original human-readable progress output.
+type textReporter struct {
+	w io.Writer
+}
+
+// NewTextReporter returns a Reporter that prints progress as plain text to w.
+func NewTextReporter(w io.Writer) Reporter {
+	return &textReporter{w: w}
+}
+
+func (r *textReporter) ImageStart(relPath string, index, total int) {
+	fmt.Fprintf(r.w, "[%d/%d] Processing: %s\n", index, total, relPath)
+}
+
+func (r *textReporter) ImageDone(relPath string, index, total int, err error) {
+	if err != nil {
+		fmt.Fprintf(r.w, "  ✗ Failed: %v\n\n", err)
+		return
+	}
+	fmt.Fprintf(r.w, "  ✓ Success\n\n")
+}
+
+func (r *textReporter) Summary(stats ProcessingStats) {
+	fmt.Fprintf(r.w, "Images processed: %d/%d\n", stats.ProcessedImages, stats.TotalImages)
+	if stats.FailedImages > 0 {
+		fmt.Fprintf(r.w, "Failed: %d\n", stats.FailedImages)
+	}
+}
+
+func (r *textReporter) Status(message string) {
+	fmt.Fprintln(r.w, message)
+}
+
+func (r *textReporter) Report(report *AnalysisReport) {
+	fmt.Fprintf(r.w, "Analysis: %s\n", report.Path)
+	fmt.Fprintln(r.w, strings.Repeat("-", 50))
+	for _, img := range report.Images {
+		fmt.Fprintf(r.w, "  %s: %d -> %d bytes\n", img.Path, img.OriginalSize, img.ProjectedSize)
+	}
+	fmt.Fprintf(r.w, "Original EPUB size: %.2f MB\n", float64(report.OriginalEPUBSize)/(1024*1024))
+	fmt.Fprintf(r.w, "Projected EPUB size: %.2f MB\n", float64(report.ProjectedEPUBSize)/(1024*1024))
+	if report.OriginalEPUBSize > 0 {
+		fmt.Fprintf(r.w, "Projected reduction: %.1f%%\n",
+			(1-float64(report.ProjectedEPUBSize)/float64(report.OriginalEPUBSize))*100)
+	}
+	fmt.Fprintf(r.w, "Recommended: -resize %d -quality %d\n", report.RecommendedResizePercent, report.RecommendedQuality)
+	fmt.Fprintln(r.w)
+}
+
+// jsonReporter emits one JSON object per line (JSON Lines), suitable for
+// machine consumption in CI.
+type jsonReporter struct {
+	w   io.Writer
+	enc *json.Encoder
+}
+
+// NewJSONReporter returns a Reporter that writes newline-delimited JSON
+// events to w.
+func NewJSONReporter(w io.Writer) Reporter {
+	return &jsonReporter{w: w, enc: json.NewEncoder(w)}
+}
+
+func (r *jsonReporter) ImageStart(relPath string, index, total int) {
+	r.enc.Encode(map[string]any{
+		"event": "image_start",
+		"path":  relPath,
+		"index": index,
+		"total": total,
+	})
+}
+
+func (r *jsonReporter) ImageDone(relPath string, index, total int, err error) {
+	event := map[string]any{
+		"event":   "image_done",
+		"path":    relPath,
+		"index":   index,
+		"total":   total,
+		"success": err == nil,
+	}
+	if err != nil {
+		event["error"] = err.Error()
+	}
+	r.enc.Encode(event)
+}
+
+func (r *jsonReporter) Summary(stats ProcessingStats) {
+	r.enc.Encode(map[string]any{
+		"event":            "summary",
+		"total_images":     stats.TotalImages,
+		"processed_images": stats.ProcessedImages,
+		"failed_images":    stats.FailedImages,
+		"original_size":    stats.OriginalSize,
+		"new_size":         stats.NewSize,
+	})
+}
+
+func (r *jsonReporter) Status(message string) {
+	r.enc.Encode(map[string]any{
+		"event":   "status",
+		"message": message,
+	})
+}
+
+func (r *jsonReporter) Report(report *AnalysisReport) {
+	r.enc.Encode(map[string]any{
+		"event":  "analysis",
+		"report": report,
+	})
+}
+
+// silentReporter discards all events, for library callers that poll
+// EPUBProcessor's stats directly instead of watching progress output.
+type silentReporter struct{}
+
+// NewSilentReporter returns a Reporter that produces no output.
+func NewSilentReporter() Reporter {
+	return silentReporter{}
+}
+
+func (silentReporter) ImageStart(relPath string, index, total int)         {}
+func (silentReporter) ImageDone(relPath string, index, total int, _ error) {}
+func (silentReporter) Summary(stats ProcessingStats)                       {}
+func (silentReporter) Status(message string)                               {}
+func (silentReporter) Report(report *AnalysisReport)                       {}
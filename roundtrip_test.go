@@ -0,0 +1,208 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/GLobyNew/compressEpubImages/opf"
+)
+
+const roundtripContainer = `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>`
+
+const roundtripPackage = `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" unique-identifier="bookid">
+  <metadata></metadata>
+  <manifest>
+    <item id="img-ch1" href="images/ch1/cover.jpg" media-type="image/jpeg"/>
+    <item id="img-ch2" href="images/ch2/cover.jpg" media-type="image/jpeg"/>
+    <item id="chap1" href="text/ch1.xhtml" media-type="application/xhtml+xml"/>
+    <item id="chap2" href="text/ch2.xhtml" media-type="application/xhtml+xml"/>
+  </manifest>
+</package>`
+
+const roundtripCh1 = `<html><body><img src="../images/ch1/cover.jpg"/></body></html>`
+const roundtripCh2 = `<html><body><img src="../images/ch2/cover.jpg"/></body></html>`
+
+// buildTestEPUB writes a minimal EPUB to dir whose two chapters each
+// reference a same-named "cover.jpg" image in a different directory, the
+// scenario that exposed the basename-collision bug in reference rewriting.
+func buildTestEPUB(t *testing.T, dir string) string {
+	t.Helper()
+
+	jpegData := encodeTestJPEG(t)
+
+	files := map[string]string{
+		"mimetype":               "application/epub+zip",
+		"META-INF/container.xml": roundtripContainer,
+		"OEBPS/content.opf":      roundtripPackage,
+		"OEBPS/text/ch1.xhtml":   roundtripCh1,
+		"OEBPS/text/ch2.xhtml":   roundtripCh2,
+	}
+
+	epubPath := filepath.Join(dir, "book.epub")
+	out, err := os.Create(epubPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+
+	zw := zip.NewWriter(out)
+	for name, content := range files {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"OEBPS/images/ch1/cover.jpg", "OEBPS/images/ch2/cover.jpg"} {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(jpegData); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return epubPath
+}
+
+func encodeTestJPEG(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 16), G: uint8(y * 16), B: 128, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// readZipFile returns the contents of name within the zip at path.
+func readZipFile(t *testing.T, path, name string) []byte {
+	t.Helper()
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		if f.Name == name {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rc.Close()
+			data, err := io.ReadAll(rc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return data
+		}
+	}
+	t.Fatalf("%s not found in %s", name, path)
+	return nil
+}
+
+// TestStreamAndTempDirProcessingAgree re-encodes the same EPUB via
+// processEPUBStream and processEPUBViaTempDir, forcing a format change (jpeg
+// -> png) that requires the manifest and every XHTML reference to be
+// rewritten, and checks both pipelines produce the same renamed hrefs and
+// rewrite only the reference that actually points at each renamed image
+// (the same-basename-different-directory regression covered in the opf
+// package tests, exercised here end to end).
+func TestStreamAndTempDirProcessingAgree(t *testing.T) {
+	dir := t.TempDir()
+	epubPath := buildTestEPUB(t, dir)
+
+	cfg := Config{ResizePercent: 100, Quality: 90, Encoder: EncoderPNG}
+
+	streamOut := filepath.Join(dir, "stream.epub")
+	streamP := NewEPUBProcessor()
+	streamP.config = cfg
+	streamP.reporter = NewSilentReporter()
+	if err := streamP.processEPUBStream(epubPath, streamOut); err != nil {
+		t.Fatalf("processEPUBStream: %v", err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	workDir := t.TempDir()
+	if err := os.Chdir(workDir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	tempDirOut := filepath.Join(dir, "tempdir.epub")
+	tempDirP := NewEPUBProcessor()
+	tempDirP.config = cfg
+	tempDirP.reporter = NewSilentReporter()
+	if err := tempDirP.processEPUBViaTempDir(epubPath, tempDirOut); err != nil {
+		t.Fatalf("processEPUBViaTempDir: %v", err)
+	}
+
+	for _, out := range []string{streamOut, tempDirOut} {
+		opfData := readZipFile(t, out, "OEBPS/content.opf")
+		items, err := opf.ParseManifest(opfData)
+		if err != nil {
+			t.Fatalf("%s: ParseManifest: %v", out, err)
+		}
+		wantHrefs := map[string]bool{"images/ch1/cover.png": false, "images/ch2/cover.png": false}
+		for _, it := range items {
+			if _, ok := wantHrefs[it.Href]; !ok {
+				t.Errorf("%s: unexpected manifest href %q", out, it.Href)
+				continue
+			}
+			wantHrefs[it.Href] = true
+			if it.MediaType != "image/png" {
+				t.Errorf("%s: item %s media-type = %q, want image/png", out, it.Href, it.MediaType)
+			}
+		}
+		for href, found := range wantHrefs {
+			if !found {
+				t.Errorf("%s: manifest missing rewritten href %q", out, href)
+			}
+		}
+
+		ch1 := string(readZipFile(t, out, "OEBPS/text/ch1.xhtml"))
+		if !strings.Contains(ch1, "../images/ch1/cover.png") {
+			t.Errorf("%s: ch1.xhtml not rewritten to cover.png: %s", out, ch1)
+		}
+		ch2 := string(readZipFile(t, out, "OEBPS/text/ch2.xhtml"))
+		if !strings.Contains(ch2, "../images/ch2/cover.png") {
+			t.Errorf("%s: ch2.xhtml not rewritten to cover.png: %s", out, ch2)
+		}
+
+		if _, _, err := image.DecodeConfig(bytes.NewReader(readZipFile(t, out, "OEBPS/images/ch1/cover.png"))); err != nil {
+			t.Errorf("%s: images/ch1/cover.png is not a valid image: %v", out, err)
+		}
+		if _, _, err := image.DecodeConfig(bytes.NewReader(readZipFile(t, out, "OEBPS/images/ch2/cover.png"))); err != nil {
+			t.Errorf("%s: images/ch2/cover.png is not a valid image: %v", out, err)
+		}
+	}
+}
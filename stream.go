@@ -0,0 +1,302 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/GLobyNew/compressEpubImages/opf"
+)
+
+// streamRename records the outcome of re-encoding one manifest image entry:
+// its (possibly unchanged) new href/media-type and the re-encoded bytes
+// that should replace the original zip entry.
+type streamRename struct {
+	item         *opf.Item
+	newHref      string
+	newMediaType string
+	data         []byte
+}
+
+// readZipEntry reads a zip.File's contents fully into memory. It's only
+// used for small, structural files (container.xml, the OPF document,
+// XHTML/CSS references) — image entries are streamed through
+// processImageStream and everything else is copied without buffering.
+func readZipEntry(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// processEPUBStream re-encodes epubPath's manifest images and writes
+// outputPath without ever extracting the archive to disk: unchanged entries
+// are copied straight from the source zip.Reader to the destination
+// zip.Writer, and only the OPF manifest and its referencing XHTML/CSS files
+// are rewritten in memory when an image's extension changes.
+func (p *EPUBProcessor) processEPUBStream(epubPath, outputPath string) error {
+	zr, err := zip.OpenReader(epubPath)
+	if err != nil {
+		return fmt.Errorf("failed to open EPUB: %w", err)
+	}
+	defer zr.Close()
+
+	entryByName := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		entryByName[f.Name] = f
+	}
+
+	containerEntry, ok := entryByName["META-INF/container.xml"]
+	if !ok {
+		return fmt.Errorf("EPUB is missing META-INF/container.xml")
+	}
+	containerData, err := readZipEntry(containerEntry)
+	if err != nil {
+		return fmt.Errorf("read container.xml: %w", err)
+	}
+	opfName, err := opf.ParseContainer(containerData)
+	if err != nil {
+		return err
+	}
+	opfEntry, ok := entryByName[opfName]
+	if !ok {
+		return fmt.Errorf("OPF document %s referenced by container.xml not found", opfName)
+	}
+	opfData, err := readZipEntry(opfEntry)
+	if err != nil {
+		return fmt.Errorf("read OPF document %s: %w", opfName, err)
+	}
+	items, err := opf.ParseManifest(opfData)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opfName, err)
+	}
+
+	opfDir := path.Dir(opfName)
+
+	type job struct {
+		zipName string
+		entry   *zip.File
+		item    *opf.Item
+		index   int
+	}
+	var jobs []job
+	for i := range items {
+		zipName := path.Join(opfDir, items[i].Href)
+		entry, ok := entryByName[zipName]
+		if !ok {
+			return fmt.Errorf("manifest item %s (href %q) not found in archive", items[i].ID, items[i].Href)
+		}
+		jobs = append(jobs, job{zipName: zipName, entry: entry, item: &items[i], index: len(jobs)})
+	}
+
+	p.stats.TotalImages += len(jobs)
+	if len(jobs) == 0 {
+		p.reporter.Status("No manifest image items found to process")
+	} else {
+		p.reporter.Status(fmt.Sprintf("Found %d image(s) to process", len(jobs)))
+	}
+
+	renamed := make(map[string]streamRename, len(jobs)) // old zip name -> rename info
+	var renamedMu sync.Mutex
+	jobCh := make(chan job)
+
+	var wg sync.WaitGroup
+	for w := 0; w < p.workerConcurrency(len(jobs)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobCh {
+				p.reporter.ImageStart(j.zipName, j.index+1, len(jobs))
+				rn, err := p.processStreamImage(j.entry, j.item)
+				p.recordResult(err == nil)
+				p.reporter.ImageDone(j.zipName, j.index+1, len(jobs), err)
+				if err == nil {
+					renamedMu.Lock()
+					renamed[j.zipName] = *rn
+					renamedMu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, j := range jobs {
+		jobCh <- j
+	}
+	close(jobCh)
+	wg.Wait()
+
+	// Rewrite the manifest and every XHTML/CSS reference for items whose
+	// href actually changed; entries that were only recompressed in place
+	// need no text rewriting.
+	for _, rn := range renamed {
+		if rn.item.Href == rn.newHref {
+			continue
+		}
+		opfData, err = opf.RewriteOPFItem(opfData, rn.item.Href, rn.newHref, rn.newMediaType)
+		if err != nil {
+			return fmt.Errorf("%s: %w", opfName, err)
+		}
+	}
+
+	referencingData := make(map[string][]byte)
+	if len(renamed) > 0 {
+		for _, f := range zr.File {
+			if f.FileInfo().IsDir() || f.Name == opfName || !opf.IsReferencingPath(f.Name) {
+				continue
+			}
+			data, err := readZipEntry(f)
+			if err != nil {
+				return fmt.Errorf("read %s: %w", f.Name, err)
+			}
+			original := data
+			docDir := path.Dir(f.Name)
+			for oldZipName, rn := range renamed {
+				if rn.item.Href == rn.newHref {
+					continue
+				}
+				newZipName := path.Join(opfDir, rn.newHref)
+				data = opf.RewriteReference(data, docDir, oldZipName, newZipName)
+			}
+			if string(data) != string(original) {
+				referencingData[f.Name] = data
+			}
+		}
+	}
+
+	return p.writeStreamEPUB(zr, outputPath, opfName, opfData, opfDir, renamed, referencingData)
+}
+
+// processStreamImage decodes, resizes and re-encodes a single manifest
+// image entry and works out its resulting href/media-type.
+func (p *EPUBProcessor) processStreamImage(entry *zip.File, item *opf.Item) (*streamRename, error) {
+	rc, err := entry.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	p.recordSize(int64(entry.UncompressedSize64), 0)
+
+	data, enc, err := p.processImageStream(rc)
+	if err != nil {
+		return nil, err
+	}
+	p.recordSize(0, int64(len(data)))
+
+	newHref := item.Href
+	newMediaType := item.MediaType
+	if newExt := extForEncoder(enc); newExt != "" && !strings.EqualFold(path.Ext(item.Href), newExt) {
+		newHref = strings.TrimSuffix(item.Href, path.Ext(item.Href)) + newExt
+		newMediaType = mediaTypeForExt(newExt)
+	}
+
+	return &streamRename{item: item, newHref: newHref, newMediaType: newMediaType, data: data}, nil
+}
+
+// writeStreamEPUB assembles the output EPUB: mimetype first (stored,
+// uncompressed, as the spec requires), then every source entry in its
+// original order, substituting re-encoded images, the rewritten OPF, and any
+// rewritten XHTML/CSS references, and streaming everything else through
+// unchanged.
+func (p *EPUBProcessor) writeStreamEPUB(zr *zip.ReadCloser, outputPath, opfName string, opfData []byte, opfDir string, renamed map[string]streamRename, referencingData map[string][]byte) error {
+	outFile, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer outFile.Close()
+
+	zw := zip.NewWriter(outFile)
+	defer zw.Close()
+
+	if mimetypeEntry, ok := func() (*zip.File, bool) {
+		for _, f := range zr.File {
+			if f.Name == "mimetype" {
+				return f, true
+			}
+		}
+		return nil, false
+	}(); ok {
+		data, err := readZipEntry(mimetypeEntry)
+		if err != nil {
+			return fmt.Errorf("read mimetype: %w", err)
+		}
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+		if err != nil {
+			return fmt.Errorf("failed to create mimetype entry: %w", err)
+		}
+		if _, err := w.Write(data); err != nil {
+			return fmt.Errorf("failed to write mimetype: %w", err)
+		}
+	}
+
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || f.Name == "mimetype" {
+			continue
+		}
+
+		if rn, ok := renamed[f.Name]; ok {
+			newName := path.Join(opfDir, rn.newHref)
+			if err := writeZipData(zw, newName, rn.data); err != nil {
+				return err
+			}
+			continue
+		}
+		if f.Name == opfName {
+			if err := writeZipData(zw, f.Name, opfData); err != nil {
+				return err
+			}
+			continue
+		}
+		if data, ok := referencingData[f.Name]; ok {
+			if err := writeZipData(zw, f.Name, data); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := copyZipEntry(zw, f); err != nil {
+			return fmt.Errorf("failed to copy %s: %w", f.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// writeZipData writes an in-memory buffer as a deflated zip entry.
+func writeZipData(zw *zip.Writer, name string, data []byte) error {
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// copyZipEntry streams a source zip entry straight into the destination
+// archive without buffering its contents in memory.
+func copyZipEntry(zw *zip.Writer, f *zip.File) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	header, err := zip.FileInfoHeader(f.FileInfo())
+	if err != nil {
+		return err
+	}
+	header.Name = f.Name
+	header.Method = zip.Deflate
+
+	w, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, rc)
+	return err
+}